@@ -0,0 +1,56 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import "golang.org/x/net/bpf"
+
+// ipProtoUDP is IPPROTO_UDP, the IPv4 protocol number for UDP. It's the same
+// on every platform, so defaultDHCPFilterEthernet hardcodes it instead of
+// depending on golang.org/x/sys/unix, which isn't available on Windows.
+const ipProtoUDP = 17
+
+// bpfConfig holds the kernel-level packet filter to install on a raw packet
+// socket or capture handle, configured via BPFOption.
+type bpfConfig struct {
+	filter []bpf.RawInstruction
+}
+
+// BPFOption configures the classic BPF filter NewPacketUDPConn installs on
+// the underlying raw socket, BPF device, or capture handle. It is accepted
+// by NewPacketUDPConn on every platform, so callers can write OS-agnostic
+// code that installs a custom filter.
+type BPFOption func(*bpfConfig)
+
+// WithBPF installs filter in place of the default IPv4/UDP destination-port
+// filter. filter is typically assembled with golang.org/x/net/bpf, e.g. to
+// additionally match on DHCP transaction ID.
+//
+// filter is assembled against the same byte offsets defaultDHCPFilter (or
+// its per-platform equivalent) uses: a bare IPv4 packet on Linux, or a whole
+// Ethernet frame on BSD and Windows, where the link-layer header isn't
+// stripped before the filter runs.
+func WithBPF(filter []bpf.RawInstruction) BPFOption {
+	return func(c *bpfConfig) {
+		c.filter = filter
+	}
+}
+
+// defaultDHCPFilterEthernet returns a classic BPF program that accepts only
+// IPv4/UDP packets destined to dstPort, and drops everything else before it
+// reaches this process. It's used by the BSD and Windows backends, both of
+// which deliver whole Ethernet frames (unlike Linux's raw.Conn in
+// LinuxSockDGRAM mode, which strips the link-layer header): byte 23 is the
+// IPv4 protocol field, and -- assuming no IP options, i.e. a 20-byte header
+// -- bytes 36-37 are the UDP destination port.
+func defaultDHCPFilterEthernet(dstPort int) ([]bpf.RawInstruction, error) {
+	return bpf.Assemble([]bpf.Instruction{
+		bpf.LoadAbsolute{Off: 23, Size: 1},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: ipProtoUDP, SkipFalse: 3},
+		bpf.LoadAbsolute{Off: 36, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(dstPort), SkipFalse: 1},
+		bpf.RetConstant{Val: 1 << 16},
+		bpf.RetConstant{Val: 0},
+	})
+}
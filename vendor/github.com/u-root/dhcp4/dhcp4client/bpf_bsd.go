@@ -0,0 +1,153 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package dhcp4client
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+	"unsafe"
+
+	"github.com/mdlayher/raw"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+// bpfPacketConn is a net.PacketConn implemented on top of a BSD BPF device
+// (/dev/bpfN), used where AF_PACKET raw sockets (as used by mdlayher/raw on
+// Linux) aren't available.
+type bpfPacketConn struct {
+	f     *os.File
+	iface *net.Interface
+}
+
+// newBPFPacketConn opens the first free /dev/bpfN device, attaches it to
+// ifc, configures it for reading and writing complete Ethernet frames, and
+// installs filter so the kernel, rather than this process, discards
+// non-matching packets.
+func newBPFPacketConn(ifc *net.Interface, filter []bpf.RawInstruction) (net.PacketConn, error) {
+	var f *os.File
+	var err error
+	for i := 0; i < 255; i++ {
+		f, err = os.OpenFile(fmt.Sprintf("/dev/bpf%d", i), os.O_RDWR, 0)
+		if err == nil {
+			break
+		}
+	}
+	if f == nil {
+		return nil, fmt.Errorf("no free /dev/bpf device found: %w", err)
+	}
+
+	fd := int(f.Fd())
+	if err := bpfSetIface(fd, ifc.Name); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("BIOCSETIF %s: %w", ifc.Name, err)
+	}
+	// Have Read return as soon as a packet arrives, rather than waiting for
+	// the kernel's BPF buffer to fill.
+	if err := bpfSetImmediate(fd); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("BIOCIMMEDIATE: %w", err)
+	}
+	if err := bpfSetFilter(fd, filter); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("BIOCSETF: %w", err)
+	}
+
+	return &bpfPacketConn{f: f, iface: ifc}, nil
+}
+
+// bpfIfreq mirrors the BSD struct ifreq as used by BIOCSETIF, which only
+// cares about the interface name.
+type bpfIfreq struct {
+	Name [unix.IFNAMSIZ]byte
+	_    [16]byte // union of address/flags/etc, unused here
+}
+
+func bpfSetIface(fd int, name string) error {
+	var req bpfIfreq
+	copy(req.Name[:], name)
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), uintptr(unix.BIOCSETIF), uintptr(unsafe.Pointer(&req)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func bpfSetImmediate(fd int) error {
+	one := int32(1)
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), uintptr(unix.BIOCIMMEDIATE), uintptr(unsafe.Pointer(&one)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// bpfSetFilter installs filter on fd via BIOCSETF. filter is the same
+// classic BPF bytecode format SO_ATTACH_FILTER takes on Linux, since both
+// derive from the original BSD Packet Filter.
+func bpfSetFilter(fd int, filter []bpf.RawInstruction) error {
+	insns := make([]unix.BpfInsn, len(filter))
+	for i, ins := range filter {
+		insns[i] = unix.BpfInsn{Code: ins.Op, Jt: ins.Jt, Jf: ins.Jf, K: ins.K}
+	}
+	prog := unix.BpfProgram{Len: uint32(len(insns)), Insns: (*unix.BpfInsn)(unsafe.Pointer(&insns[0]))}
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), uintptr(unix.BIOCSETF), uintptr(unsafe.Pointer(&prog)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func (c *bpfPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, err := c.f.Read(b)
+	if err != nil {
+		return 0, nil, err
+	}
+	return n, &raw.Addr{HardwareAddr: c.iface.HardwareAddr}, nil
+}
+
+// WriteTo writes b (an IP+UDP packet built by UDPPacketConn.WriteTo) to the
+// BPF device as a complete Ethernet frame. Unlike Linux's raw.Conn, /dev/bpfN
+// has no sockaddr_ll to build the link-layer header from, so it must be
+// framed here: dst comes from addr (a *raw.Addr, as UDPPacketConn.WriteTo
+// always supplies), src is our own interface's hardware address.
+//
+// As required by net.PacketConn, the returned n counts only bytes of b, not
+// the prepended Ethernet header.
+func (c *bpfPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	dst := BroadcastMac
+	if a, ok := addr.(*raw.Addr); ok && a.HardwareAddr != nil {
+		dst = a.HardwareAddr
+	}
+	if _, err := c.f.Write(frameEthernet(dst, c.iface.HardwareAddr, b)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *bpfPacketConn) Close() error {
+	return c.f.Close()
+}
+
+func (c *bpfPacketConn) LocalAddr() net.Addr {
+	return &raw.Addr{HardwareAddr: c.iface.HardwareAddr}
+}
+
+func (c *bpfPacketConn) SetDeadline(t time.Time) error {
+	return c.f.SetDeadline(t)
+}
+
+func (c *bpfPacketConn) SetReadDeadline(t time.Time) error {
+	return c.f.SetReadDeadline(t)
+}
+
+func (c *bpfPacketConn) SetWriteDeadline(t time.Time) error {
+	return c.f.SetWriteDeadline(t)
+}
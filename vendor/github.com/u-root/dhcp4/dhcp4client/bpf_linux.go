@@ -0,0 +1,30 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+// defaultDHCPFilter returns a classic BPF program that accepts only IPv4/UDP
+// packets destined to dstPort, and drops everything else in the kernel
+// before it reaches this process.
+//
+// raw.ListenPacket in LinuxSockDGRAM mode delivers packets with the
+// link-layer header already stripped by the kernel, so the filter operates
+// directly on the IP header: byte 9 is the IPv4 protocol field, and --
+// assuming no IP options, i.e. a 20-byte header -- bytes 22-23 are the UDP
+// destination port.
+func defaultDHCPFilter(dstPort int) ([]bpf.RawInstruction, error) {
+	return bpf.Assemble([]bpf.Instruction{
+		bpf.LoadAbsolute{Off: 9, Size: 1},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(unix.IPPROTO_UDP), SkipFalse: 3},
+		bpf.LoadAbsolute{Off: 22, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(dstPort), SkipFalse: 1},
+		bpf.RetConstant{Val: 1 << 16},
+		bpf.RetConstant{Val: 0},
+	})
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+// testPacket builds a minimal fake packet (no real header fields besides the
+// two defaultDHCPFilter actually looks at) long enough for the filter's
+// fixed offsets to be in bounds.
+func testPacket(protocol byte, dstPort uint16) []byte {
+	pkt := make([]byte, 30)
+	pkt[9] = protocol
+	binary.BigEndian.PutUint16(pkt[22:24], dstPort)
+	return pkt
+}
+
+func TestDefaultDHCPFilter(t *testing.T) {
+	raw, err := defaultDHCPFilter(68)
+	if err != nil {
+		t.Fatalf("defaultDHCPFilter() error = %v", err)
+	}
+	insns, ok := bpf.Disassemble(raw)
+	if !ok {
+		t.Fatal("could not disassemble the instructions defaultDHCPFilter assembled")
+	}
+	vm, err := bpf.NewVM(insns)
+	if err != nil {
+		t.Fatalf("bpf.NewVM() error = %v", err)
+	}
+
+	for _, tt := range []struct {
+		name       string
+		protocol   byte
+		dstPort    uint16
+		wantAccept bool
+	}{
+		{"matching udp/68", unix.IPPROTO_UDP, 68, true},
+		{"wrong port", unix.IPPROTO_UDP, 67, false},
+		{"wrong protocol", unix.IPPROTO_TCP, 68, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := vm.Run(testPacket(tt.protocol, tt.dstPort))
+			if err != nil {
+				t.Fatalf("vm.Run() error = %v", err)
+			}
+			if accepted := n > 0; accepted != tt.wantAccept {
+				t.Errorf("accepted = %v, want %v", accepted, tt.wantAccept)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/google/netstack/tcpip"
+	"github.com/google/netstack/tcpip/header"
+	"github.com/mdlayher/raw"
+	"github.com/u-root/dhcp4/internal/buffer"
+)
+
+var (
+	BroadcastMac = net.HardwareAddr([]byte{255, 255, 255, 255, 255, 255})
+)
+
+// UDPPacketConn implements net.PacketConn and marshals and unmarshals UDP
+// packets.
+//
+// The underlying net.PacketConn is constructed differently per OS -- see
+// NewPacketUDPConn in the OS-specific conn_*.go files (NewIPv4UDPConn there
+// returns a plain UDP socket, not a UDPPacketConn) -- but the packet
+// marshaling and matching logic here is shared across all of them.
+type UDPPacketConn struct {
+	net.PacketConn
+
+	// boundAddr is the address this UDPPacketConn is "bound" to.
+	//
+	// Calls to ReadFrom will only return packets destined to this address.
+	boundAddr *net.UDPAddr
+
+	// ethernetFraming is true if the underlying PacketConn's ReadFrom
+	// returns whole Ethernet frames (as BPF and pcap-based conns do),
+	// rather than bare IP packets (as Linux's SOCK_DGRAM AF_PACKET
+	// conns do).
+	ethernetFraming bool
+
+	// strict enables IPv4/UDP checksum validation in ReadFrom. Fragments
+	// are rejected by ReadFrom whether or not strict is set.
+	strict bool
+
+	// acceptEthDst, if set, is consulted with the Ethernet destination
+	// address of every received frame; frames for which it returns false
+	// are discarded. Only consulted when ethernetFraming is true.
+	acceptEthDst func(net.HardwareAddr) bool
+
+	// setReadDeadline, if set, is used by ReadFromContext instead of
+	// upc.PacketConn.SetReadDeadline. See SetReadDeadlineFunc.
+	setReadDeadline func(time.Time) error
+}
+
+// Option configures optional behavior of a UDPPacketConn.
+type Option func(*UDPPacketConn)
+
+// WithEthernetFraming tells the UDPPacketConn that the underlying
+// net.PacketConn's ReadFrom returns whole Ethernet frames (optionally
+// 802.1Q-tagged), rather than bare IP packets. BPF- and pcap-based conns
+// (used on BSD, macOS, and Windows) need this; Linux's raw.ListenPacket in
+// LinuxSockDGRAM mode does not.
+func WithEthernetFraming() Option {
+	return func(upc *UDPPacketConn) {
+		upc.ethernetFraming = true
+	}
+}
+
+// WithStrictValidation enables IPv4 and UDP checksum validation. Fragmented
+// datagrams are dropped by ReadFrom with or without this option.
+func WithStrictValidation() Option {
+	return func(upc *UDPPacketConn) {
+		upc.strict = true
+	}
+}
+
+// WithEthernetFilter only accepts frames whose Ethernet destination address
+// satisfies accept. It has no effect unless WithEthernetFraming is also
+// used. See AcceptEthernetUnicastOrBroadcast for the common case of
+// accepting frames destined to a particular interface or the broadcast
+// address.
+func WithEthernetFilter(accept func(net.HardwareAddr) bool) Option {
+	return func(upc *UDPPacketConn) {
+		upc.acceptEthDst = accept
+	}
+}
+
+// AcceptEthernetUnicastOrBroadcast returns an accept function for
+// WithEthernetFilter that only accepts frames destined to mac or to the
+// Ethernet broadcast address.
+func AcceptEthernetUnicastOrBroadcast(mac net.HardwareAddr) func(net.HardwareAddr) bool {
+	return func(dst net.HardwareAddr) bool {
+		return bytes.Equal(dst, mac) || bytes.Equal(dst, BroadcastMac)
+	}
+}
+
+// NewBroadcastUDPConn returns a PacketConn that marshals and unmarshals UDP
+// packets, sending them to the broadcast MAC at on rawPacketConn, except for
+// packets written to a DHCPUnicastAddr, which are sent to its HardwareAddr.
+//
+// Calls to ReadFrom will only return packets destined to boundAddr.
+func NewBroadcastUDPConn(rawPacketConn net.PacketConn, boundAddr *net.UDPAddr, opts ...Option) net.PacketConn {
+	upc := &UDPPacketConn{
+		PacketConn: rawPacketConn,
+		boundAddr:  boundAddr,
+	}
+	for _, opt := range opts {
+		opt(upc)
+	}
+	return upc
+}
+
+func udpMatch(addr *net.UDPAddr, bound *net.UDPAddr) bool {
+	if bound == nil {
+		return true
+	}
+	if bound.IP != nil && !bound.IP.Equal(addr.IP) {
+		return false
+	}
+	return bound.Port == addr.Port
+}
+
+// DHCPUnicastAddr is a destination address for a reply that must be sent
+// unicast at the link layer to a specific client, rather than broadcast.
+//
+// This is used by DHCP servers replying to a client that has its broadcast
+// flag unset: the client has not configured yiaddr on its interface yet, so
+// the reply cannot be routed normally and must be addressed directly to
+// HardwareAddr with YIAddr as the IP destination.
+type DHCPUnicastAddr struct {
+	// HardwareAddr is the link-layer address the reply is sent to.
+	HardwareAddr net.HardwareAddr
+
+	// YIAddr is the IP address offered/assigned to the client (DHCP's
+	// yiaddr), used as the IP destination address since the client has not
+	// configured it yet.
+	YIAddr net.IP
+
+	// Port is the UDP destination port, usually the DHCP client port (68).
+	Port int
+}
+
+// Network implements net.Addr.
+func (DHCPUnicastAddr) Network() string { return "dhcp4client-unicast" }
+
+// String implements net.Addr.
+func (a DHCPUnicastAddr) String() string {
+	return fmt.Sprintf("%s(%s)", a.YIAddr, a.HardwareAddr)
+}
+
+// WriteTo implements net.PacketConn.WriteTo.
+//
+// WriteTo wraps the given packet in the appropriate UDP and IP header before
+// sending it on the packet conn. If addr is a *net.UDPAddr, the packet is
+// broadcast at the link layer, as before. If addr is a DHCPUnicastAddr, the
+// packet is instead sent unicast to addr.HardwareAddr with addr.YIAddr as
+// the IP destination -- used to reply to clients that aren't reachable by
+// normal routing yet.
+func (upc *UDPPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		packet := udp4pkt(b, a, upc.boundAddr)
+		return upc.PacketConn.WriteTo(packet, &raw.Addr{HardwareAddr: BroadcastMac})
+
+	case DHCPUnicastAddr:
+		udpAddr := &net.UDPAddr{IP: a.YIAddr, Port: a.Port}
+		packet := udp4pkt(b, udpAddr, upc.boundAddr)
+		return upc.PacketConn.WriteTo(packet, &raw.Addr{HardwareAddr: a.HardwareAddr})
+
+	default:
+		return 0, fmt.Errorf("must supply *net.UDPAddr or DHCPUnicastAddr")
+	}
+}
+
+func udp4pkt(packet []byte, dest *net.UDPAddr, src *net.UDPAddr) []byte {
+	ipLen := header.IPv4MinimumSize
+	udpLen := header.UDPMinimumSize
+
+	h := make([]byte, 0, ipLen+udpLen+len(packet))
+	hdr := buffer.New(h)
+
+	ipv4fields := &header.IPv4Fields{
+		IHL:         header.IPv4MinimumSize,
+		TotalLength: uint16(ipLen + udpLen + len(packet)),
+		TTL:         30,
+		Protocol:    uint8(header.UDPProtocolNumber),
+		SrcAddr:     tcpip.Address(src.IP.To4()),
+		DstAddr:     tcpip.Address(dest.IP.To4()),
+	}
+	ipv4hdr := header.IPv4(hdr.WriteN(ipLen))
+	ipv4hdr.Encode(ipv4fields)
+	ipv4hdr.SetChecksum(^ipv4hdr.CalculateChecksum())
+
+	udphdr := header.UDP(hdr.WriteN(udpLen))
+	udphdr.Encode(&header.UDPFields{
+		SrcPort: uint16(src.Port),
+		DstPort: uint16(dest.Port),
+		Length:  uint16(udpLen + len(packet)),
+	})
+
+	xsum := header.Checksum(packet, header.PseudoHeaderChecksum(
+		ipv4hdr.TransportProtocol(), ipv4fields.SrcAddr, ipv4fields.DstAddr))
+	udphdr.SetChecksum(^udphdr.CalculateChecksum(xsum, udphdr.Length()))
+
+	hdr.WriteBytes(packet)
+	return hdr.Data()
+}
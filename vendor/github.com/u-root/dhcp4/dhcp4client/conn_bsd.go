@@ -0,0 +1,106 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package dhcp4client
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// NewIPv4UDPConn returns a UDP connection bound to both the interface and
+// port given based on a IPv4 DGRAM socket. The UDP connection allows
+// broadcasting.
+//
+// BSD-derived kernels (and Darwin) don't support SO_BINDTODEVICE, so the
+// interface is bound to indirectly by looking up its address and binding to
+// that instead. If the interface has no IPv4 address, the socket is bound to
+// the wildcard address and is not tied to the interface.
+func NewIPv4UDPConn(iface string, port int) (net.PacketConn, error) {
+	ifc, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := ifc.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	var laddr unix.SockaddrInet4
+	laddr.Port = port
+	for _, addr := range addrs {
+		if ipn, ok := addr.(*net.IPNet); ok {
+			if ip4 := ipn.IP.To4(); ip4 != nil {
+				copy(laddr.Addr[:], ip4)
+				break
+			}
+		}
+	}
+
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, unix.IPPROTO_UDP)
+	if err != nil {
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), "")
+	// net.FilePacketConn dups the FD, so we have to close this in any case.
+	defer f.Close()
+
+	// Allow broadcasting.
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_BROADCAST, 1); err != nil {
+		return nil, err
+	}
+	// Allow reusing the addr to aid debugging.
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); err != nil {
+		return nil, err
+	}
+	// Bind only to the interface's own address, or the wildcard address if
+	// it has none (no SO_BINDTODEVICE on BSD).
+	if err := unix.Bind(fd, &laddr); err != nil {
+		return nil, err
+	}
+
+	return net.FilePacketConn(f)
+}
+
+// NewPacketUDPConn returns a UDP connection bound to the interface and port
+// given based on a BPF device. All packets are broadcasted, except those
+// written to a DHCPUnicastAddr, which are sent unicast to its HardwareAddr.
+//
+// mdlayher/raw's AF_PACKET-based implementation is Linux-only, so on BSD we
+// talk to the interface through /dev/bpfN instead.
+//
+// A classic BPF filter is attached to the device so that the kernel, rather
+// than this process, discards everything but IPv4/UDP packets destined to
+// port. Pass WithBPF to install a custom filter instead, e.g. to also match
+// on DHCP transaction ID.
+func NewPacketUDPConn(iface string, port int, opts ...BPFOption) (net.PacketConn, error) {
+	ifc, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &bpfConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	filter := cfg.filter
+	if filter == nil {
+		filter, err = defaultDHCPFilterEthernet(port)
+		if err != nil {
+			return nil, fmt.Errorf("dhcp4client: failed to assemble BPF filter: %w", err)
+		}
+	}
+
+	bpfConn, err := newBPFPacketConn(ifc, filter)
+	if err != nil {
+		return nil, fmt.Errorf("dhcp4client: failed to open BPF device for %s: %w", iface, err)
+	}
+	return NewBroadcastUDPConn(bpfConn, &net.UDPAddr{Port: port}, WithEthernetFraming()), nil
+}
@@ -9,18 +9,11 @@ import (
 	"net"
 	"os"
 
-	"github.com/google/netstack/tcpip"
-	"github.com/google/netstack/tcpip/header"
 	"github.com/mdlayher/ethernet"
 	"github.com/mdlayher/raw"
-	"github.com/u-root/dhcp4/internal/buffer"
 	"golang.org/x/sys/unix"
 )
 
-var (
-	BroadcastMac = net.HardwareAddr([]byte{255, 255, 255, 255, 255, 255})
-)
-
 // NewIPv4UDPConn returns a UDP connection bound to both the interface and port
 // given based on a IPv4 DGRAM socket. The UDP connection allows broadcasting.
 func NewIPv4UDPConn(iface string, port int) (net.PacketConn, error) {
@@ -54,7 +47,14 @@ func NewIPv4UDPConn(iface string, port int) (net.PacketConn, error) {
 
 // NewPacketUDPConn returns a UDP connection bound to the interface and port
 // given based on a raw packet socket. All packets are broadcasted.
-func NewPacketUDPConn(iface string, port int) (net.PacketConn, error) {
+// The exception is packets written to a DHCPUnicastAddr, which are sent
+// unicast to its HardwareAddr.
+//
+// A classic BPF filter is attached to the socket so that the kernel, rather
+// than this process, discards everything but IPv4/UDP packets destined to
+// port. Pass WithBPF to install a custom filter instead, e.g. to also match
+// on DHCP transaction ID.
+func NewPacketUDPConn(iface string, port int, opts ...BPFOption) (net.PacketConn, error) {
 	ifc, err := net.InterfaceByName(iface)
 	if err != nil {
 		return nil, err
@@ -63,124 +63,21 @@ func NewPacketUDPConn(iface string, port int) (net.PacketConn, error) {
 	if err != nil {
 		return nil, err
 	}
-	return NewBroadcastUDPConn(rawConn, &net.UDPAddr{Port: port}), nil
-}
-
-// UDPPacketConn implements net.PacketConn and marshals and unmarshals UDP
-// packets.
-type UDPPacketConn struct {
-	net.PacketConn
-
-	// boundAddr is the address this UDPPacketConn is "bound" to.
-	//
-	// Calls to ReadFrom will only return packets destined to this address.
-	boundAddr *net.UDPAddr
-}
-
-// NewBroadcastUDPConn returns a PacketConn that marshals and unmarshals UDP
-// packets, sending them to the broadcast MAC at on rawPacketConn.
-//
-// Calls to ReadFrom will only return packets destined to boundAddr.
-func NewBroadcastUDPConn(rawPacketConn net.PacketConn, boundAddr *net.UDPAddr) net.PacketConn {
-	return &UDPPacketConn{
-		PacketConn: rawPacketConn,
-		boundAddr:  boundAddr,
-	}
-}
 
-func udpMatch(addr *net.UDPAddr, bound *net.UDPAddr) bool {
-	if bound == nil {
-		return true
+	cfg := &bpfConfig{}
+	for _, opt := range opts {
+		opt(cfg)
 	}
-	if bound.IP != nil && !bound.IP.Equal(addr.IP) {
-		return false
-	}
-	return bound.Port == addr.Port
-}
-
-// ReadFrom implements net.PacketConn.ReadFrom.
-//
-// ReadFrom reads raw IP packets and will try to match them against
-// upc.boundAddr. Any matching packets are returned via the given buffer.
-func (upc *UDPPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
-	ipLen := header.IPv4MaximumHeaderSize
-	udpLen := header.UDPMinimumSize
-
-	for {
-		pkt := make([]byte, ipLen+udpLen+len(b))
-		n, _, err := upc.PacketConn.ReadFrom(pkt)
+	filter := cfg.filter
+	if filter == nil {
+		filter, err = defaultDHCPFilter(port)
 		if err != nil {
-			return 0, nil, err
+			return nil, fmt.Errorf("dhcp4client: failed to assemble BPF filter: %w", err)
 		}
-		pkt = pkt[:n]
-		buf := buffer.New(pkt)
-
-		// To read the header length, access data directly.
-		ipHdr := header.IPv4(buf.Data())
-		ipHdr = header.IPv4(buf.Consume(int(ipHdr.HeaderLength())))
-
-		if ipHdr.TransportProtocol() != header.UDPProtocolNumber {
-			continue
-		}
-		udpHdr := header.UDP(buf.Consume(udpLen))
-
-		addr := &net.UDPAddr{
-			IP:   net.IP(ipHdr.DestinationAddress()),
-			Port: int(udpHdr.DestinationPort()),
-		}
-		if !udpMatch(addr, upc.boundAddr) {
-			continue
-		}
-		return copy(b, buf.Remaining()), addr, nil
 	}
-}
-
-// WriteTo implements net.PacketConn.WriteTo and broadcasts all packets at the
-// raw socket level.
-//
-// WriteTo wraps the given packet in the appropriate UDP and IP header before
-// sending it on the packet conn.
-func (upc *UDPPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
-	udpAddr, ok := addr.(*net.UDPAddr)
-	if !ok {
-		return 0, fmt.Errorf("must supply UDPAddr")
+	if err := rawConn.SetBPF(filter); err != nil {
+		return nil, fmt.Errorf("dhcp4client: failed to attach BPF filter: %w", err)
 	}
 
-	// Using the boundAddr is not quite right here, but it works.
-	packet := udp4pkt(b, udpAddr, upc.boundAddr)
-	return upc.PacketConn.WriteTo(packet, &raw.Addr{HardwareAddr: BroadcastMac})
-}
-
-func udp4pkt(packet []byte, dest *net.UDPAddr, src *net.UDPAddr) []byte {
-	ipLen := header.IPv4MinimumSize
-	udpLen := header.UDPMinimumSize
-
-	h := make([]byte, 0, ipLen+udpLen+len(packet))
-	hdr := buffer.New(h)
-
-	ipv4fields := &header.IPv4Fields{
-		IHL:         header.IPv4MinimumSize,
-		TotalLength: uint16(ipLen + udpLen + len(packet)),
-		TTL:         30,
-		Protocol:    uint8(header.UDPProtocolNumber),
-		SrcAddr:     tcpip.Address(src.IP.To4()),
-		DstAddr:     tcpip.Address(dest.IP.To4()),
-	}
-	ipv4hdr := header.IPv4(hdr.WriteN(ipLen))
-	ipv4hdr.Encode(ipv4fields)
-	ipv4hdr.SetChecksum(^ipv4hdr.CalculateChecksum())
-
-	udphdr := header.UDP(hdr.WriteN(udpLen))
-	udphdr.Encode(&header.UDPFields{
-		SrcPort: uint16(src.Port),
-		DstPort: uint16(dest.Port),
-		Length:  uint16(udpLen + len(packet)),
-	})
-
-	xsum := header.Checksum(packet, header.PseudoHeaderChecksum(
-		ipv4hdr.TransportProtocol(), ipv4fields.SrcAddr, ipv4fields.DstAddr))
-	udphdr.SetChecksum(^udphdr.CalculateChecksum(xsum, udphdr.Length()))
-
-	hdr.WriteBytes(packet)
-	return hdr.Data()
+	return NewBroadcastUDPConn(rawConn, &net.UDPAddr{Port: port}), nil
 }
@@ -0,0 +1,99 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestFrameEthernet(t *testing.T) {
+	dst := net.HardwareAddr{1, 2, 3, 4, 5, 6}
+	src := net.HardwareAddr{6, 5, 4, 3, 2, 1}
+	payload := []byte{0xde, 0xad, 0xbe, 0xef}
+
+	frame := frameEthernet(dst, src, payload)
+
+	if len(frame) != 14+len(payload) {
+		t.Fatalf("len(frame) = %d, want %d", len(frame), 14+len(payload))
+	}
+	if got := net.HardwareAddr(frame[0:6]); got.String() != dst.String() {
+		t.Errorf("dst MAC = %s, want %s", got, dst)
+	}
+	if got := net.HardwareAddr(frame[6:12]); got.String() != src.String() {
+		t.Errorf("src MAC = %s, want %s", got, src)
+	}
+	if got := binary.BigEndian.Uint16(frame[12:14]); got != etherTypeIPv4 {
+		t.Errorf("ethertype = %#04x, want %#04x", got, etherTypeIPv4)
+	}
+	if string(frame[14:]) != string(payload) {
+		t.Errorf("payload = %x, want %x", frame[14:], payload)
+	}
+}
+
+// onesComplementSum computes the Internet checksum (RFC 1071) folding sum of
+// b, independent of the netstack/header package used by udp4pkt itself --
+// for a correct checksum, summing the data plus the checksum field it
+// produced must fold to 0xffff.
+func onesComplementSum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	return uint16(sum)
+}
+
+func TestUDP4PktChecksums(t *testing.T) {
+	src := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 10), Port: 68}
+	dest := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 1), Port: 67}
+	payload := []byte("hello dhcp")
+
+	pkt := udp4pkt(payload, dest, src)
+
+	const ipLen, udpLen = 20, 8
+	if got, want := len(pkt), ipLen+udpLen+len(payload); got != want {
+		t.Fatalf("len(pkt) = %d, want %d", got, want)
+	}
+
+	if sum := onesComplementSum(pkt[:ipLen]); sum != 0xffff {
+		t.Errorf("IPv4 header checksum invalid, folded sum = %#04x, want 0xffff", sum)
+	}
+	if got := net.IP(pkt[12:16]); !got.Equal(src.IP.To4()) {
+		t.Errorf("src IP = %v, want %v", got, src.IP)
+	}
+	if got := net.IP(pkt[16:20]); !got.Equal(dest.IP.To4()) {
+		t.Errorf("dst IP = %v, want %v", got, dest.IP)
+	}
+
+	udp := pkt[ipLen:]
+	if got, want := binary.BigEndian.Uint16(udp[0:2]), uint16(src.Port); got != want {
+		t.Errorf("src port = %d, want %d", got, want)
+	}
+	if got, want := binary.BigEndian.Uint16(udp[2:4]), uint16(dest.Port); got != want {
+		t.Errorf("dst port = %d, want %d", got, want)
+	}
+	if got, want := binary.BigEndian.Uint16(udp[4:6]), uint16(udpLen+len(payload)); got != want {
+		t.Errorf("UDP length = %d, want %d", got, want)
+	}
+	if string(udp[udpLen:]) != string(payload) {
+		t.Errorf("payload = %q, want %q", udp[udpLen:], payload)
+	}
+
+	pseudo := make([]byte, 0, 12+len(udp))
+	pseudo = append(pseudo, pkt[12:20]...)                     // src + dst IP
+	pseudo = append(pseudo, 0, 17)                             // zero + UDP protocol number
+	pseudo = append(pseudo, byte(len(udp)>>8), byte(len(udp))) // UDP length, again
+	pseudo = append(pseudo, udp...)
+	if sum := onesComplementSum(pseudo); sum != 0xffff {
+		t.Errorf("UDP checksum invalid, folded sum = %#04x, want 0xffff", sum)
+	}
+}
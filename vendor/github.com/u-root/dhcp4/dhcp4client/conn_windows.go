@@ -0,0 +1,217 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/pcap"
+	"github.com/mdlayher/raw"
+	"golang.org/x/net/bpf"
+)
+
+// pcapReadPollInterval bounds how long a single ZeroCopyReadPacketData call
+// blocks when no packet is available, so pcapPacketConn.ReadFrom wakes up
+// often enough to notice a deadline set by SetReadDeadline.
+const pcapReadPollInterval = 200 * time.Millisecond
+
+// NewIPv4UDPConn returns a UDP connection bound to both the interface and
+// port given based on a IPv4 DGRAM socket. The UDP connection allows
+// broadcasting.
+//
+// Windows has no SO_BINDTODEVICE/BPF equivalent reachable from net.FilePacketConn,
+// so this binds a regular UDP socket to the interface's own address instead.
+// If the interface has no IPv4 address, the socket is bound to the wildcard
+// address and is not tied to the interface.
+func NewIPv4UDPConn(iface string, port int) (net.PacketConn, error) {
+	ifc, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := ifc.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	var ip net.IP
+	for _, addr := range addrs {
+		if ipn, ok := addr.(*net.IPNet); ok {
+			if ip4 := ipn.IP.To4(); ip4 != nil {
+				ip = ip4
+				break
+			}
+		}
+	}
+
+	return net.ListenUDP("udp4", &net.UDPAddr{IP: ip, Port: port})
+}
+
+// NewPacketUDPConn returns a UDP connection bound to the interface and port
+// given based on an Npcap/WinPcap live capture handle. All packets are
+// broadcasted, except those written to a DHCPUnicastAddr, which are sent
+// unicast to its HardwareAddr.
+//
+// Windows has no raw AF_PACKET sockets, so packet-level access goes through
+// Npcap (via gopacket/pcap) instead.
+//
+// A classic BPF filter is attached to the handle so that Npcap, rather than
+// this process, discards everything but IPv4/UDP packets destined to port.
+// Pass WithBPF to install a custom filter instead, e.g. to also match on
+// DHCP transaction ID.
+func NewPacketUDPConn(iface string, port int, opts ...BPFOption) (net.PacketConn, error) {
+	devs, err := pcap.FindAllDevs()
+	if err != nil {
+		return nil, err
+	}
+	var devName string
+	for _, d := range devs {
+		if d.Name == iface || d.Description == iface {
+			devName = d.Name
+			break
+		}
+	}
+	if devName == "" {
+		return nil, fmt.Errorf("dhcp4client: no Npcap device found matching interface %q", iface)
+	}
+
+	// promisc=false so this handle only sees traffic the NIC already
+	// accepts (unicast to it, or broadcast) -- the same exposure the
+	// Linux raw-socket and BSD /dev/bpfN backends have, neither of which
+	// sets the promiscuous-mode equivalent.
+	//
+	// A finite read timeout (rather than pcap.BlockForever) is what lets
+	// pcapPacketConn.ReadFrom wake up periodically and notice a deadline
+	// set via SetReadDeadline/SetDeadline.
+	handle, err := pcap.OpenLive(devName, 65536, false, pcapReadPollInterval)
+	if err != nil {
+		return nil, fmt.Errorf("dhcp4client: pcap.OpenLive(%s): %w", devName, err)
+	}
+	if err := handle.SetDirection(pcap.DirectionIn); err != nil {
+		handle.Close()
+		return nil, err
+	}
+
+	ifc, err := net.InterfaceByName(iface)
+	if err != nil {
+		handle.Close()
+		return nil, err
+	}
+
+	cfg := &bpfConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	filter := cfg.filter
+	if filter == nil {
+		filter, err = defaultDHCPFilterEthernet(port)
+		if err != nil {
+			handle.Close()
+			return nil, fmt.Errorf("dhcp4client: failed to assemble BPF filter: %w", err)
+		}
+	}
+	if err := handle.SetBPFInstructionFilter(toPcapBPFInstructions(filter)); err != nil {
+		handle.Close()
+		return nil, fmt.Errorf("dhcp4client: failed to attach BPF filter: %w", err)
+	}
+
+	conn := &pcapPacketConn{handle: handle, iface: ifc}
+	return NewBroadcastUDPConn(conn, &net.UDPAddr{Port: port}, WithEthernetFraming(),
+		WithEthernetFilter(AcceptEthernetUnicastOrBroadcast(ifc.HardwareAddr))), nil
+}
+
+// toPcapBPFInstructions converts filter, assembled with golang.org/x/net/bpf,
+// into gopacket/pcap's equivalent raw instruction type so it can be
+// installed on a *pcap.Handle with SetBPFInstructionFilter.
+func toPcapBPFInstructions(filter []bpf.RawInstruction) []pcap.BPFInstruction {
+	insns := make([]pcap.BPFInstruction, len(filter))
+	for i, ins := range filter {
+		insns[i] = pcap.BPFInstruction{Code: ins.Op, Jt: ins.Jt, Jf: ins.Jf, K: ins.K}
+	}
+	return insns
+}
+
+// pcapPacketConn adapts a *pcap.Handle to net.PacketConn.
+type pcapPacketConn struct {
+	handle *pcap.Handle
+	iface  *net.Interface
+
+	// readDeadlineMu guards readDeadline, which SetDeadline/SetReadDeadline
+	// may set from a goroutine other than the one blocked in ReadFrom.
+	readDeadlineMu sync.Mutex
+
+	// readDeadline is consulted each time the handle's own read poll
+	// (bounded by pcapReadPollInterval) times out with no packet, since
+	// pcap.Handle has no deadline concept of its own.
+	readDeadline time.Time
+}
+
+func (c *pcapPacketConn) getReadDeadline() time.Time {
+	c.readDeadlineMu.Lock()
+	defer c.readDeadlineMu.Unlock()
+	return c.readDeadline
+}
+
+// ReadFrom implements net.PacketConn.ReadFrom. It returns os.ErrDeadlineExceeded
+// (which implements net.Error with Timeout() true) once readDeadline has
+// passed, so ReadFromContext's poll loop in context.go notices and re-checks
+// its context instead of blocking forever.
+func (c *pcapPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		data, _, err := c.handle.ZeroCopyReadPacketData()
+		if err == pcap.NextErrorTimeoutExpired {
+			if deadline := c.getReadDeadline(); !deadline.IsZero() && !time.Now().Before(deadline) {
+				return 0, nil, os.ErrDeadlineExceeded
+			}
+			continue
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		return copy(b, data), &net.UDPAddr{}, nil
+	}
+}
+
+// WriteTo writes b (an IP+UDP packet built by UDPPacketConn.WriteTo) to the
+// Npcap handle as a complete Ethernet frame. Npcap, like /dev/bpfN, has no
+// kernel assist for building the link-layer header: dst comes from addr (a
+// *raw.Addr, as UDPPacketConn.WriteTo always supplies), src is our own
+// interface's hardware address.
+func (c *pcapPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	dst := BroadcastMac
+	if a, ok := addr.(*raw.Addr); ok && a.HardwareAddr != nil {
+		dst = a.HardwareAddr
+	}
+	frame := frameEthernet(dst, c.iface.HardwareAddr, b)
+	if err := c.handle.WritePacketData(frame); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *pcapPacketConn) Close() error {
+	c.handle.Close()
+	return nil
+}
+
+func (c *pcapPacketConn) LocalAddr() net.Addr {
+	return &net.UDPAddr{}
+}
+
+func (c *pcapPacketConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *pcapPacketConn) SetReadDeadline(t time.Time) error {
+	c.readDeadlineMu.Lock()
+	defer c.readDeadlineMu.Unlock()
+	c.readDeadline = t
+	return nil
+}
+
+func (c *pcapPacketConn) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,92 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"os"
+	"time"
+)
+
+// readPollInterval bounds how long ReadFromContext waits on the underlying
+// PacketConn between checks of ctx.Done(), for a ctx with no deadline of its
+// own.
+const readPollInterval = 500 * time.Millisecond
+
+// SetReadDeadlineFunc overrides how ReadFromContext sets read deadlines on
+// the underlying net.PacketConn. It defaults to upc.PacketConn.SetReadDeadline;
+// override it for PacketConn implementations where plain SetReadDeadline
+// isn't sufficient (e.g. one backed by a capture handle with its own timeout
+// knob).
+func (upc *UDPPacketConn) SetReadDeadlineFunc(fn func(time.Time) error) {
+	upc.setReadDeadline = fn
+}
+
+func (upc *UDPPacketConn) readDeadlineFunc() func(time.Time) error {
+	if upc.setReadDeadline != nil {
+		return upc.setReadDeadline
+	}
+	return upc.PacketConn.SetReadDeadline
+}
+
+// ReadFromContext is like ReadFrom, but polls ctx.Done() between read
+// attempts instead of blocking indefinitely on non-matching traffic, so
+// retry/backoff loops (e.g. repeated DHCPDISCOVERs) can be cancelled without
+// leaking a goroutine stuck in ReadFrom.
+//
+// If ctx is cancelled, ReadFromContext returns ctx.Err(); if ctx's deadline
+// is what elapsed, it returns os.ErrDeadlineExceeded instead, matching what
+// callers already expect from a timed-out net.Conn read.
+func (upc *UDPPacketConn) ReadFromContext(ctx context.Context, b []byte) (int, net.Addr, error) {
+	setDeadline := upc.readDeadlineFunc()
+	defer setDeadline(time.Time{})
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, nil, ctxErr(ctx)
+		}
+
+		next := time.Now().Add(readPollInterval)
+		if deadline, ok := ctx.Deadline(); ok && deadline.Before(next) {
+			next = deadline
+		}
+		if err := setDeadline(next); err != nil {
+			return 0, nil, err
+		}
+
+		n, addr, err := upc.ReadFrom(b)
+		if err == nil {
+			return n, addr, nil
+		}
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			// Either our poll interval or ctx's own deadline expired;
+			// loop around to re-check ctx.Err().
+			continue
+		}
+		return 0, nil, err
+	}
+}
+
+// WriteToContext is like WriteTo, but fails fast with ctx's error if ctx is
+// already done. WriteTo itself never blocks, so there's nothing to cancel
+// mid-write.
+func (upc *UDPPacketConn) WriteToContext(ctx context.Context, b []byte, addr net.Addr) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, ctxErr(ctx)
+	}
+	return upc.WriteTo(b, addr)
+}
+
+// ctxErr translates ctx.Err() into os.ErrDeadlineExceeded when a deadline
+// (rather than an explicit cancellation) is what caused it, so callers can
+// keep using the same errors.Is(err, os.ErrDeadlineExceeded) check they'd
+// use against a plain net.Conn.
+func ctxErr(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return os.ErrDeadlineExceeded
+	}
+	return ctx.Err()
+}
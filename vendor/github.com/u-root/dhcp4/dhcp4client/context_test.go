@@ -0,0 +1,151 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTimeoutErr implements net.Error the way a real timed-out read would,
+// so ReadFromContext's `nerr.Timeout()` check treats it as a poll expiring
+// rather than a real I/O error.
+type fakeTimeoutErr struct{}
+
+func (fakeTimeoutErr) Error() string   { return "fake timeout" }
+func (fakeTimeoutErr) Timeout() bool   { return true }
+func (fakeTimeoutErr) Temporary() bool { return true }
+
+// fakeDeadlineConn is a net.PacketConn whose ReadFrom blocks until the
+// deadline most recently set via SetReadDeadline, then returns
+// fakeTimeoutErr -- standing in for a real socket/capture handle so
+// ReadFromContext's polling behavior can be exercised without real I/O.
+type fakeDeadlineConn struct {
+	mu            sync.Mutex
+	deadline      time.Time
+	readDeadlines []time.Time
+}
+
+func (f *fakeDeadlineConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	f.mu.Lock()
+	deadline := f.deadline
+	f.mu.Unlock()
+	time.Sleep(time.Until(deadline))
+	return 0, nil, fakeTimeoutErr{}
+}
+
+func (f *fakeDeadlineConn) WriteTo(b []byte, addr net.Addr) (int, error) { return len(b), nil }
+func (f *fakeDeadlineConn) Close() error                                 { return nil }
+func (f *fakeDeadlineConn) LocalAddr() net.Addr                          { return &net.UDPAddr{} }
+func (f *fakeDeadlineConn) SetDeadline(t time.Time) error                { return f.SetReadDeadline(t) }
+
+func (f *fakeDeadlineConn) SetReadDeadline(t time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deadline = t
+	f.readDeadlines = append(f.readDeadlines, t)
+	return nil
+}
+
+func (f *fakeDeadlineConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func TestCtxErr(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		ctx  func() context.Context
+		want error
+	}{
+		{
+			name: "deadline exceeded becomes os.ErrDeadlineExceeded",
+			ctx: func() context.Context {
+				ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+				t.Cleanup(cancel)
+				return ctx
+			},
+			want: os.ErrDeadlineExceeded,
+		},
+		{
+			name: "explicit cancellation stays context.Canceled",
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			},
+			want: context.Canceled,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := tt.ctx()
+			<-ctx.Done() // make sure ctx.Err() is populated before we read it
+			if got := ctxErr(ctx); !errors.Is(got, tt.want) {
+				t.Errorf("ctxErr() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadFromContextDeadline(t *testing.T) {
+	fc := &fakeDeadlineConn{}
+	upc := &UDPPacketConn{PacketConn: fc}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err := upc.ReadFromContext(ctx, make([]byte, 1500))
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("ReadFromContext took %v, want well under readPollInterval (500ms)", elapsed)
+	}
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("ReadFromContext() error = %v, want os.ErrDeadlineExceeded", err)
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if len(fc.readDeadlines) == 0 {
+		t.Fatal("SetReadDeadline was never called")
+	}
+	ctxDeadline, _ := ctx.Deadline()
+	if got := fc.readDeadlines[0]; got.After(ctxDeadline) {
+		t.Errorf("first SetReadDeadline = %v, want at or before ctx's deadline %v", got, ctxDeadline)
+	}
+	if last := fc.readDeadlines[len(fc.readDeadlines)-1]; !last.IsZero() {
+		t.Errorf("final SetReadDeadline = %v, want zero (cleared on return)", last)
+	}
+}
+
+func TestReadFromContextCancel(t *testing.T) {
+	fc := &fakeDeadlineConn{}
+	upc := &UDPPacketConn{PacketConn: fc}
+
+	// Bounded by an explicit deadline so the underlying fake read wakes up
+	// promptly; cancel fires well before it so ctxErr sees Canceled, not
+	// DeadlineExceeded.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	time.AfterFunc(5*time.Millisecond, cancel)
+
+	_, _, err := upc.ReadFromContext(ctx, make([]byte, 1500))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadFromContext() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestWriteToContextFailsFastWhenDone(t *testing.T) {
+	fc := &fakeDeadlineConn{}
+	upc := &UDPPacketConn{PacketConn: fc}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := upc.WriteToContext(ctx, []byte("hi"), &net.UDPAddr{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("WriteToContext() error = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import "net"
+
+// etherTypeIPv4 is the EtherType value for an IPv4 payload.
+const etherTypeIPv4 = 0x0800
+
+// frameEthernet prepends a 14-byte Ethernet header to payload (an IPv4
+// packet), addressed from src to dst.
+//
+// This is needed by the BSD and Windows packet-socket backends
+// (bpfPacketConn, pcapPacketConn): unlike Linux's raw.Conn in
+// LinuxSockDGRAM mode, where the kernel builds the link-layer header from
+// the sockaddr_ll passed to sendto, /dev/bpfN and Npcap writes require a
+// complete frame supplied by the caller.
+func frameEthernet(dst, src net.HardwareAddr, payload []byte) []byte {
+	frame := make([]byte, 14+len(payload))
+	copy(frame[0:6], dst)
+	copy(frame[6:12], src)
+	frame[12] = byte(etherTypeIPv4 >> 8)
+	frame[13] = byte(etherTypeIPv4)
+	copy(frame[14:], payload)
+	return frame
+}
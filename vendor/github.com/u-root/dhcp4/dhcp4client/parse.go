@@ -0,0 +1,128 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// ReadFrom implements net.PacketConn.ReadFrom.
+//
+// ReadFrom decodes raw frames with gopacket: it transparently unwraps a
+// leading 802.1Q tag if present, rejects fragmented IPv4 datagrams (this
+// package does not reassemble), and -- if WithStrictValidation was given --
+// validates the IPv4 and UDP checksums. Only packets matching upc.boundAddr
+// are returned; everything else is read and discarded.
+func (upc *UDPPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	first := layers.LayerTypeIPv4
+	if upc.ethernetFraming {
+		first = layers.LayerTypeEthernet
+	}
+
+	for {
+		pkt := make([]byte, 65536)
+		n, _, err := upc.PacketConn.ReadFrom(pkt)
+		if err != nil {
+			return 0, nil, err
+		}
+		pkt = pkt[:n]
+
+		packet := gopacket.NewPacket(pkt, first, gopacket.DecodeOptions{
+			Lazy:   true,
+			NoCopy: true,
+		})
+
+		if upc.ethernetFraming {
+			eth, ok := packet.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+			if !ok {
+				continue
+			}
+			if upc.acceptEthDst != nil && !upc.acceptEthDst(eth.DstMAC) {
+				continue
+			}
+			// A Dot1Q layer, if present, is unwrapped automatically by
+			// gopacket's decoding chain: the IPv4 layer below is found
+			// regardless of whether a VLAN tag separates it from Ethernet.
+		}
+
+		ip4, ok := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+		if !ok {
+			continue
+		}
+		// We don't reassemble fragmented datagrams; drop anything that
+		// isn't a complete, unfragmented packet.
+		if ip4.FragOffset != 0 || ip4.Flags&layers.IPv4MoreFragments != 0 {
+			continue
+		}
+		if upc.strict && !validIPv4Checksum(ip4) {
+			continue
+		}
+
+		udp, ok := packet.Layer(layers.LayerTypeUDP).(*layers.UDP)
+		if !ok {
+			continue
+		}
+		if upc.strict && !validUDPChecksum(udp, ip4) {
+			continue
+		}
+
+		addr := &net.UDPAddr{
+			IP:   ip4.DstIP,
+			Port: int(udp.DstPort),
+		}
+		if !udpMatch(addr, upc.boundAddr) {
+			continue
+		}
+		return copy(b, udp.Payload), addr, nil
+	}
+}
+
+// validIPv4Checksum recomputes ip4's header checksum and compares it against
+// the checksum it was decoded with.
+func validIPv4Checksum(ip4 *layers.IPv4) bool {
+	want := ip4.Checksum
+
+	cp := *ip4
+	cp.Checksum = 0
+	buf := gopacket.NewSerializeBuffer()
+	if err := cp.SerializeTo(buf, gopacket.SerializeOptions{ComputeChecksums: true}); err != nil {
+		return false
+	}
+	if len(buf.Bytes()) < 12 {
+		return false
+	}
+	return binary.BigEndian.Uint16(buf.Bytes()[10:12]) == want
+}
+
+// validUDPChecksum recomputes udp's checksum (over the IPv4 pseudo-header)
+// and compares it against the checksum it was decoded with. A zero checksum
+// in the original packet means the sender opted out of UDP checksumming, so
+// it's always accepted.
+func validUDPChecksum(udp *layers.UDP, ip4 *layers.IPv4) bool {
+	if udp.Checksum == 0 {
+		return true
+	}
+	want := udp.Checksum
+
+	cp := *udp
+	cp.Checksum = 0
+	if err := cp.SetNetworkLayerForChecksum(ip4); err != nil {
+		return false
+	}
+	// The UDP checksum covers the payload too, so serialize it behind the
+	// header for SerializeTo to include it.
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{ComputeChecksums: true}, &cp, gopacket.Payload(udp.Payload)); err != nil {
+		return false
+	}
+	if len(buf.Bytes()) < 8 {
+		return false
+	}
+	return binary.BigEndian.Uint16(buf.Bytes()[6:8]) == want
+}
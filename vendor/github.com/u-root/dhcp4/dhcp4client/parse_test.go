@@ -0,0 +1,84 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func buildTestIPv4UDP(t *testing.T, payload []byte) []byte {
+	t.Helper()
+
+	ip4 := &layers.IPv4{
+		Version:  4,
+		IHL:      5,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.IPv4(192, 168, 1, 10),
+		DstIP:    net.IPv4(192, 168, 1, 1),
+	}
+	udp := &layers.UDP{SrcPort: 68, DstPort: 67}
+	if err := udp.SetNetworkLayerForChecksum(ip4); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{ComputeChecksums: true, FixLengths: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip4, udp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestValidIPv4Checksum(t *testing.T) {
+	raw := buildTestIPv4UDP(t, []byte("dhcp"))
+
+	packet := gopacket.NewPacket(raw, layers.LayerTypeIPv4, gopacket.Default)
+	ip4, ok := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	if !ok {
+		t.Fatal("no IPv4 layer decoded")
+	}
+	if !validIPv4Checksum(ip4) {
+		t.Error("validIPv4Checksum() = false for an unmodified packet, want true")
+	}
+
+	corrupted := append([]byte(nil), raw...)
+	corrupted[0] ^= 0xff // flip version/IHL, which feeds into the header checksum
+	cpacket := gopacket.NewPacket(corrupted, layers.LayerTypeIPv4, gopacket.Default)
+	if cip4, ok := cpacket.Layer(layers.LayerTypeIPv4).(*layers.IPv4); ok && validIPv4Checksum(cip4) {
+		t.Error("validIPv4Checksum() = true for a corrupted packet, want false")
+	}
+}
+
+func TestValidUDPChecksum(t *testing.T) {
+	raw := buildTestIPv4UDP(t, []byte("dhcp"))
+
+	packet := gopacket.NewPacket(raw, layers.LayerTypeIPv4, gopacket.Default)
+	ip4 := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	udp := packet.Layer(layers.LayerTypeUDP).(*layers.UDP)
+	if !validUDPChecksum(udp, ip4) {
+		t.Error("validUDPChecksum() = false for an unmodified packet, want true")
+	}
+
+	corrupted := append([]byte(nil), raw...)
+	corrupted[len(corrupted)-1] ^= 0xff // flip a payload byte
+	cpacket := gopacket.NewPacket(corrupted, layers.LayerTypeIPv4, gopacket.Default)
+	cip4 := cpacket.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	cudp := cpacket.Layer(layers.LayerTypeUDP).(*layers.UDP)
+	if validUDPChecksum(cudp, cip4) {
+		t.Error("validUDPChecksum() = true for a corrupted packet, want false")
+	}
+}
+
+func TestValidUDPChecksumZeroIsAlwaysValid(t *testing.T) {
+	udp := &layers.UDP{Checksum: 0}
+	if !validUDPChecksum(udp, &layers.IPv4{}) {
+		t.Error("validUDPChecksum() = false for a zero (disabled) checksum, want true")
+	}
+}
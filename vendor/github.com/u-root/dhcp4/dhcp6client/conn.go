@@ -0,0 +1,149 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dhcp6client provides raw and multicast UDP transports for
+// speaking DHCPv6, mirroring dhcp4client's DHCPv4 transports.
+package dhcp6client
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/google/netstack/tcpip"
+	"github.com/google/netstack/tcpip/header"
+	"github.com/mdlayher/raw"
+	"github.com/u-root/dhcp4/internal/buffer"
+)
+
+var (
+	// AllDHCPRelayAgentsAndServers is the DHCPv6 All_DHCP_Relay_Agents_and_Servers
+	// multicast address, ff02::1:2, used by clients to reach servers and
+	// relays on the local link.
+	AllDHCPRelayAgentsAndServers = net.ParseIP("ff02::1:2")
+
+	// allDHCPRelayAgentsAndServersMAC is the Ethernet multicast address
+	// IPv6 multicast frames to AllDHCPRelayAgentsAndServers are sent to,
+	// derived from the standard IPv6-multicast-to-Ethernet mapping
+	// (33:33:xx:xx:xx:xx from the last 4 bytes of the IPv6 address).
+	allDHCPRelayAgentsAndServersMAC = net.HardwareAddr([]byte{0x33, 0x33, 0x00, 0x01, 0x00, 0x02})
+)
+
+const (
+	// ServerPort is the UDP port DHCPv6 servers and relays listen on.
+	ServerPort = 547
+
+	// ClientPort is the UDP port DHCPv6 clients listen on.
+	ClientPort = 546
+)
+
+// UDPPacketConn implements net.PacketConn and marshals and unmarshals
+// DHCPv6-over-UDP-over-IPv6 packets.
+//
+// NewPacketUDPConn returns one wrapping a raw packet socket, for sending
+// before the interface has a configured address. NewIPv6UDPConn instead
+// returns a plain multicast-joined IPv6 DGRAM socket, not a UDPPacketConn.
+type UDPPacketConn struct {
+	net.PacketConn
+
+	// boundAddr is the address this UDPPacketConn is "bound" to.
+	//
+	// Calls to ReadFrom will only return packets destined to this address.
+	boundAddr *net.UDPAddr
+
+	// strict enables UDP checksum validation in ReadFrom. Fragments are
+	// rejected by ReadFrom whether or not strict is set. See
+	// dhcp4client.WithStrictValidation, whose gopacket-based parsing and
+	// validation this mirrors.
+	strict bool
+}
+
+// Option configures optional behavior of a UDPPacketConn.
+type Option func(*UDPPacketConn)
+
+// WithStrictValidation enables UDP checksum validation. Fragmented
+// datagrams (ones with an IPv6 Fragment extension header) are dropped by
+// ReadFrom with or without this option.
+func WithStrictValidation() Option {
+	return func(upc *UDPPacketConn) {
+		upc.strict = true
+	}
+}
+
+// NewMulticastUDPConn returns a PacketConn that marshals and unmarshals UDP
+// packets, sending them to the DHCPv6 relay/server multicast MAC on
+// rawPacketConn.
+//
+// Calls to ReadFrom will only return packets destined to boundAddr.
+func NewMulticastUDPConn(rawPacketConn net.PacketConn, boundAddr *net.UDPAddr, opts ...Option) net.PacketConn {
+	upc := &UDPPacketConn{
+		PacketConn: rawPacketConn,
+		boundAddr:  boundAddr,
+	}
+	for _, opt := range opts {
+		opt(upc)
+	}
+	return upc
+}
+
+func udpMatch(addr *net.UDPAddr, bound *net.UDPAddr) bool {
+	if bound == nil {
+		return true
+	}
+	if bound.IP != nil && !bound.IP.Equal(addr.IP) {
+		return false
+	}
+	return bound.Port == addr.Port
+}
+
+// WriteTo implements net.PacketConn.WriteTo and sends all packets to the
+// DHCPv6 relay/server multicast MAC at the raw socket level.
+//
+// WriteTo wraps the given packet in the appropriate UDP and IPv6 header
+// before sending it on the packet conn.
+func (upc *UDPPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, fmt.Errorf("must supply UDPAddr")
+	}
+
+	packet := udp6pkt(b, udpAddr, upc.boundAddr)
+	return upc.PacketConn.WriteTo(packet, &raw.Addr{HardwareAddr: allDHCPRelayAgentsAndServersMAC})
+}
+
+func udp6pkt(packet []byte, dest *net.UDPAddr, src *net.UDPAddr) []byte {
+	ipLen := header.IPv6MinimumSize
+	udpLen := header.UDPMinimumSize
+
+	h := make([]byte, 0, ipLen+udpLen+len(packet))
+	hdr := buffer.New(h)
+
+	srcAddr := tcpip.Address(src.IP.To16())
+	dstAddr := tcpip.Address(dest.IP.To16())
+
+	ipv6fields := &header.IPv6Fields{
+		PayloadLength:     uint16(udpLen + len(packet)),
+		TransportProtocol: header.UDPProtocolNumber,
+		HopLimit:          1,
+		SrcAddr:           srcAddr,
+		DstAddr:           dstAddr,
+	}
+	ipv6hdr := header.IPv6(hdr.WriteN(ipLen))
+	ipv6hdr.Encode(ipv6fields)
+
+	udphdr := header.UDP(hdr.WriteN(udpLen))
+	udphdr.Encode(&header.UDPFields{
+		SrcPort: uint16(src.Port),
+		DstPort: uint16(dest.Port),
+		Length:  uint16(udpLen + len(packet)),
+	})
+
+	// Unlike IPv4, IPv6 has no header checksum; the UDP checksum (over the
+	// IPv6 pseudo-header) is mandatory instead of optional.
+	xsum := header.Checksum(packet, header.PseudoHeaderChecksum(
+		header.UDPProtocolNumber, srcAddr, dstAddr))
+	udphdr.SetChecksum(^udphdr.CalculateChecksum(xsum, udphdr.Length()))
+
+	hdr.WriteBytes(packet)
+	return hdr.Data()
+}
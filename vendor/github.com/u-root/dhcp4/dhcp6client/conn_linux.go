@@ -0,0 +1,88 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp6client
+
+import (
+	"net"
+	"os"
+
+	"github.com/mdlayher/ethernet"
+	"github.com/mdlayher/raw"
+	"golang.org/x/sys/unix"
+)
+
+// NewIPv6UDPConn returns a UDP connection bound to both the interface and
+// port given, based on an IPv6 DGRAM socket joined to the
+// AllDHCPRelayAgentsAndServers multicast group.
+//
+// This is the normal DHCPv6 transport: once the interface has a link-local
+// address (which it typically does via SLAAC before DHCP ever runs), plain
+// multicast UDP works and there's no need for NewPacketUDPConn's raw socket.
+func NewIPv6UDPConn(iface string, port int) (net.PacketConn, error) {
+	ifc, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := unix.Socket(unix.AF_INET6, unix.SOCK_DGRAM, unix.IPPROTO_UDP)
+	if err != nil {
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), "")
+	// net.FilePacketConn dups the FD, so we have to close this in any case.
+	defer f.Close()
+
+	// Allow reusing the addr to aid debugging.
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); err != nil {
+		return nil, err
+	}
+	// Send our multicast traffic (and only our multicast traffic) out this
+	// interface, and keep it on the local link.
+	if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_MULTICAST_IF, ifc.Index); err != nil {
+		return nil, err
+	}
+	if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_MULTICAST_HOPS, 1); err != nil {
+		return nil, err
+	}
+
+	// Join the All_DHCP_Relay_Agents_and_Servers group so we receive
+	// multicast replies/requests addressed to it.
+	mreq := &unix.IPv6Mreq{Interface: uint32(ifc.Index)}
+	copy(mreq.Multiaddr[:], AllDHCPRelayAgentsAndServers.To16())
+	if err := unix.SetsockoptIPv6Mreq(fd, unix.IPPROTO_IPV6, unix.IPV6_JOIN_GROUP, mreq); err != nil {
+		return nil, err
+	}
+
+	// Bind directly to the interface.
+	if err := unix.BindToDevice(fd, iface); err != nil {
+		return nil, err
+	}
+	// Bind to the port.
+	if err := unix.Bind(fd, &unix.SockaddrInet6{Port: port}); err != nil {
+		return nil, err
+	}
+
+	return net.FilePacketConn(f)
+}
+
+// NewPacketUDPConn returns a UDP connection bound to the interface and port
+// given based on a raw packet socket. All packets are sent to the
+// All_DHCP_Relay_Agents_and_Servers multicast MAC.
+//
+// Unlike NewIPv6UDPConn, this works before the interface has any IPv6
+// address configured at all (not even link-local), by sending raw Ethernet
+// frames with a manually constructed IPv6 header whose source address is
+// the unspecified address (::).
+func NewPacketUDPConn(iface string, port int) (net.PacketConn, error) {
+	ifc, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	rawConn, err := raw.ListenPacket(ifc, uint16(ethernet.EtherTypeIPv6), &raw.Config{LinuxSockDGRAM: true})
+	if err != nil {
+		return nil, err
+	}
+	return NewMulticastUDPConn(rawConn, &net.UDPAddr{Port: port}), nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp6client
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// onesComplementSum computes the Internet checksum (RFC 1071) folding sum of
+// b, independent of the netstack/header package used by udp6pkt itself.
+func onesComplementSum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	return uint16(sum)
+}
+
+func TestUDP6PktChecksum(t *testing.T) {
+	src := &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: ClientPort}
+	dest := &net.UDPAddr{IP: AllDHCPRelayAgentsAndServers, Port: ServerPort}
+	payload := []byte("hello dhcpv6")
+
+	pkt := udp6pkt(payload, dest, src)
+
+	const ipLen, udpLen = 40, 8
+	if got, want := len(pkt), ipLen+udpLen+len(payload); got != want {
+		t.Fatalf("len(pkt) = %d, want %d", got, want)
+	}
+
+	if got := net.IP(pkt[8:24]); !got.Equal(src.IP) {
+		t.Errorf("src IP = %v, want %v", got, src.IP)
+	}
+	if got := net.IP(pkt[24:40]); !got.Equal(dest.IP) {
+		t.Errorf("dst IP = %v, want %v", got, dest.IP)
+	}
+	if got, want := pkt[6], uint8(17); got != want {
+		t.Errorf("next header = %d, want %d (UDP)", got, want)
+	}
+
+	udp := pkt[ipLen:]
+	if got, want := binary.BigEndian.Uint16(udp[0:2]), uint16(src.Port); got != want {
+		t.Errorf("src port = %d, want %d", got, want)
+	}
+	if got, want := binary.BigEndian.Uint16(udp[2:4]), uint16(dest.Port); got != want {
+		t.Errorf("dst port = %d, want %d", got, want)
+	}
+	if string(udp[udpLen:]) != string(payload) {
+		t.Errorf("payload = %q, want %q", udp[udpLen:], payload)
+	}
+
+	// IPv6 pseudo-header (src + dst + UDP length as a 32-bit field + zero
+	// padding + next header) + UDP header + payload must fold to 0xffff.
+	pseudo := make([]byte, 0, 40+len(udp))
+	pseudo = append(pseudo, pkt[8:40]...) // src + dst IP
+	pseudo = append(pseudo, 0, 0, 0, byte(len(udp)))
+	pseudo = append(pseudo, 0, 0, 0, 17) // 3 zero bytes + next header (UDP)
+	pseudo = append(pseudo, udp...)
+	if sum := onesComplementSum(pseudo); sum != 0xffff {
+		t.Errorf("UDP checksum invalid, folded sum = %#04x, want 0xffff", sum)
+	}
+}
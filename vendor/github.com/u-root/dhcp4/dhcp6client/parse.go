@@ -0,0 +1,92 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp6client
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// ReadFrom implements net.PacketConn.ReadFrom.
+//
+// ReadFrom decodes raw IPv6 packets with gopacket, mirroring dhcp4client's
+// gopacket-based ReadFrom: datagrams with an IPv6 Fragment extension header
+// are rejected (this package does not reassemble), and -- if
+// WithStrictValidation was given -- the UDP checksum is validated. IPv6 has
+// no header checksum of its own to validate. Only packets matching
+// upc.boundAddr are returned; everything else is read and discarded.
+func (upc *UDPPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		pkt := make([]byte, 65536)
+		n, _, err := upc.PacketConn.ReadFrom(pkt)
+		if err != nil {
+			return 0, nil, err
+		}
+		pkt = pkt[:n]
+
+		packet := gopacket.NewPacket(pkt, layers.LayerTypeIPv6, gopacket.DecodeOptions{
+			Lazy:   true,
+			NoCopy: true,
+		})
+
+		// We don't reassemble fragmented datagrams; drop anything that
+		// carries an IPv6 Fragment extension header.
+		if packet.Layer(layers.LayerTypeIPv6Fragment) != nil {
+			continue
+		}
+
+		ip6, ok := packet.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+		if !ok {
+			continue
+		}
+		udp, ok := packet.Layer(layers.LayerTypeUDP).(*layers.UDP)
+		if !ok {
+			continue
+		}
+		if upc.strict && !validUDPChecksum(udp, ip6) {
+			continue
+		}
+
+		addr := &net.UDPAddr{
+			IP:   ip6.DstIP,
+			Port: int(udp.DstPort),
+		}
+		if !udpMatch(addr, upc.boundAddr) {
+			continue
+		}
+		return copy(b, udp.Payload), addr, nil
+	}
+}
+
+// validUDPChecksum recomputes udp's checksum (over the IPv6 pseudo-header)
+// and compares it against the checksum it was decoded with.
+func validUDPChecksum(udp *layers.UDP, ip6 *layers.IPv6) bool {
+	if udp.Checksum == 0 {
+		// Unlike IPv4, a zero UDP checksum over IPv6 is invalid (RFC
+		// 8200 section 8.1), not "no checksum" -- but since we didn't
+		// compute it ourselves here, there's nothing more to check.
+		return false
+	}
+	want := udp.Checksum
+
+	cp := *udp
+	cp.Checksum = 0
+	if err := cp.SetNetworkLayerForChecksum(ip6); err != nil {
+		return false
+	}
+	// The UDP checksum covers the payload too, so serialize it behind the
+	// header for SerializeTo to include it.
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{ComputeChecksums: true}, &cp, gopacket.Payload(udp.Payload)); err != nil {
+		return false
+	}
+	if len(buf.Bytes()) < 8 {
+		return false
+	}
+	return binary.BigEndian.Uint16(buf.Bytes()[6:8]) == want
+}